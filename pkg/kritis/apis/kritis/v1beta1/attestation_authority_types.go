@@ -0,0 +1,106 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SignatureFormat selects the signature scheme an AttestationAuthority signs
+// and verifies attestations with.
+type SignatureFormat string
+
+const (
+	// PgpSignatureFormat signs attestations with a PGP key (the default).
+	PgpSignatureFormat SignatureFormat = "pgp"
+	// CosignSignatureFormat signs attestations with a cosign-style
+	// DSSE/in-toto envelope over an ECDSA or Ed25519 key, or a KMS key.
+	CosignSignatureFormat SignatureFormat = "cosign"
+)
+
+// AttestationAuthority is a CRD that represents a Grafeas/Container Analysis
+// Attestation Authority Note, plus the key material Kritis uses to create
+// and verify attestations against it.
+type AttestationAuthority struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// NoteReference names the project the backend Note lives in, in the
+	// form "<api>/projects/<project_id>", e.g. "v1alpha1/projects/my-project".
+	// The Container Analysis backend names the Note
+	// "projects/<project_id>/notes/<AttestationAuthority name>"; the Grafeas
+	// backend ignores NoteReference and uses its own project.
+	NoteReference string `json:"noteReference"`
+
+	// PrivateKeySecretName is the name of the Kubernetes Secret holding the
+	// key material used to sign attestations for this authority. It is
+	// interpreted as a secrets.PgpSigningSecret or a secrets.CosignSigningSecret
+	// depending on SignatureFormat.
+	PrivateKeySecretName string `json:"privateKeySecretName"`
+
+	// PublicKeyData is the PEM/armored public key that verifiers use to
+	// check attestations created by this authority.
+	PublicKeyData string `json:"publicKeyData,omitempty"`
+
+	// SignatureFormat selects which signature scheme this authority signs
+	// and verifies with. Defaults to PgpSignatureFormat when empty, so
+	// existing AttestationAuthority resources keep working unchanged.
+	SignatureFormat SignatureFormat `json:"signatureFormat,omitempty"`
+
+	// RekorLogURL, when set, is the base URL of a Rekor transparency log
+	// that cosign-format attestations are checked against during
+	// verification and recorded on the occurrence. Only used when
+	// SignatureFormat is CosignSignatureFormat.
+	RekorLogURL string `json:"rekorLogUrl,omitempty"`
+
+	// Status reports the reconcile state of this AttestationAuthority,
+	// including whether it is synced to Binary Authorization.
+	Status AttestationAuthorityStatus `json:"status,omitempty"`
+}
+
+// AttestationAuthorityConditionType is a type of condition an
+// AttestationAuthority's Status can report.
+type AttestationAuthorityConditionType string
+
+// BinaryAuthorizationSynced is true once a matching Binary Authorization
+// Attestor has been created/updated for this AttestationAuthority, and
+// false (with Reason/Message set) if the last sync attempt failed.
+const BinaryAuthorizationSynced AttestationAuthorityConditionType = "BinaryAuthorizationSynced"
+
+// AttestationAuthorityCondition is a single observed condition of an
+// AttestationAuthority, following the standard Kubernetes condition shape.
+type AttestationAuthorityCondition struct {
+	Type               AttestationAuthorityConditionType `json:"type"`
+	Status             corev1.ConditionStatus            `json:"status"`
+	LastTransitionTime metav1.Time                       `json:"lastTransitionTime,omitempty"`
+	Reason             string                            `json:"reason,omitempty"`
+	Message            string                            `json:"message,omitempty"`
+}
+
+// AttestationAuthorityStatus is the observed state of an
+// AttestationAuthority.
+type AttestationAuthorityStatus struct {
+	Conditions []AttestationAuthorityCondition `json:"conditions,omitempty"`
+}
+
+// AttestationAuthorityList is a list of AttestationAuthority resources.
+type AttestationAuthorityList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AttestationAuthority `json:"items"`
+}
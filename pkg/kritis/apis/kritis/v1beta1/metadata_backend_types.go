@@ -0,0 +1,61 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MetadataBackendType identifies which metadata.Fetcher implementation a
+// MetadataBackend resource configures.
+type MetadataBackendType string
+
+const (
+	// ContainerAnalysisBackend talks to Google Container Analysis.
+	ContainerAnalysisBackend MetadataBackendType = "ContainerAnalysis"
+	// GrafeasBackend talks to a self-hosted Grafeas server.
+	GrafeasBackend MetadataBackendType = "Grafeas"
+)
+
+// MetadataBackend is a CRD that configures which vulnerability/attestation
+// metadata backend Kritis should use, and how to reach it. A cluster runs
+// with at most one active MetadataBackend; the controller flag
+// --metadata-backend overrides it when no resource exists.
+type MetadataBackend struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Type selects the backend implementation.
+	Type MetadataBackendType `json:"type"`
+
+	// Address is the backend's endpoint, e.g. "grafeas.grafeas-system:8443"
+	// for a self-hosted Grafeas server. Unused for ContainerAnalysisBackend,
+	// which always talks to Google's regional endpoint.
+	Address string `json:"address,omitempty"`
+
+	// CredentialsSecretName names a Kubernetes Secret holding the client
+	// credentials (TLS client cert/key, or a GCP service account key for
+	// ContainerAnalysisBackend) used to authenticate to Address.
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+}
+
+// MetadataBackendList is a list of MetadataBackend resources.
+type MetadataBackendList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MetadataBackend `json:"items"`
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package binauthz syncs Kritis AttestationAuthority resources to Binary
+// Authorization Attestors, so GKE's Binary Authorization enforcement can
+// reference the same Grafeas/Container Analysis Note Kritis attests to.
+package binauthz
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/util"
+	binauthzv1 "google.golang.org/api/binaryauthorization/v1"
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// enableSync backs the --enable-binauthz-sync controller flag, which lets
+// operators turn the Binary Authorization integration off entirely for
+// clusters running Kritis-only enforcement, without deleting their
+// AttestationAuthority resources. NewSyncerFromFlags reads it.
+var enableSync = flag.Bool("enable-binauthz-sync", true, "sync AttestationAuthority resources to Binary Authorization Attestors")
+
+// Syncer upserts a Binary Authorization Attestor for each
+// AttestationAuthority Kritis manages, and deletes that Attestor when the
+// AttestationAuthority is removed. Enabled lets operators turn the
+// integration off entirely for clusters running Kritis-only enforcement,
+// without deleting their AttestationAuthority resources.
+type Syncer struct {
+	client  *binauthzv1.Service
+	project string
+	Enabled bool
+}
+
+// NewSyncer returns a Syncer that upserts Attestors under project via
+// client.
+func NewSyncer(client *binauthzv1.Service, project string, enabled bool) *Syncer {
+	return &Syncer{client: client, project: project, Enabled: enabled}
+}
+
+// NewSyncerFromFlags returns a Syncer that upserts Attestors under project
+// via client, honoring the --enable-binauthz-sync flag.
+func NewSyncerFromFlags(client *binauthzv1.Service, project string) *Syncer {
+	return NewSyncer(client, project, *enableSync)
+}
+
+// Sync upserts the Attestor backing aa, using publicKeyData as the PGP or
+// cosign public key Binary Authorization verifies with, and returns an
+// updated Status recording the outcome as a BinaryAuthorizationSynced
+// condition.
+func (s *Syncer) Sync(aa kritisv1beta1.AttestationAuthority, publicKeyData string) kritisv1beta1.AttestationAuthorityStatus {
+	if !s.Enabled {
+		return withCondition(aa.Status, corev1.ConditionFalse, "Disabled", "Binary Authorization sync is disabled")
+	}
+	key, err := publicKey(aa, publicKeyData)
+	if err != nil {
+		glog.Errorf("building Binary Authorization public key for %s: %v", aa.Name, err)
+		return withCondition(aa.Status, corev1.ConditionFalse, "InvalidPublicKey", err.Error())
+	}
+	// aa.NoteReference has the form "<api>/projects/<project_id>"; the Note
+	// itself is named after the AttestationAuthority under that project.
+	refParts := strings.Split(aa.NoteReference, "/")
+	if len(refParts) < 3 {
+		err := fmt.Errorf("invalid note reference %q for AttestationAuthority %s, want <api>/projects/<project_id>", aa.NoteReference, aa.Name)
+		glog.Error(err)
+		return withCondition(aa.Status, corev1.ConditionFalse, "InvalidNoteReference", err.Error())
+	}
+	name := attestorName(s.project, aa.Name)
+	attestor := &binauthzv1.Attestor{
+		Name: name,
+		UserOwnedGrafeasNote: &binauthzv1.UserOwnedGrafeasNote{
+			NoteReference: fmt.Sprintf("projects/%s/notes/%s", refParts[2], aa.Name),
+			PublicKeys:    []*binauthzv1.AttestorPublicKey{key},
+		},
+	}
+
+	_, err = s.client.Projects.Attestors.Get(name).Do()
+	switch {
+	case err != nil && isNotFound(err):
+		if _, err := s.client.Projects.Attestors.Create(fmt.Sprintf("projects/%s", s.project), attestor).AttestorId(aa.Name).Do(); err != nil {
+			glog.Errorf("creating Binary Authorization attestor %s: %v", name, err)
+			return withCondition(aa.Status, corev1.ConditionFalse, "CreateFailed", err.Error())
+		}
+		return withCondition(aa.Status, corev1.ConditionTrue, "Created", "attestor created")
+	case err != nil:
+		glog.Errorf("getting Binary Authorization attestor %s: %v", name, err)
+		return withCondition(aa.Status, corev1.ConditionFalse, "GetFailed", err.Error())
+	default:
+		if _, err := s.client.Projects.Attestors.Update(name, attestor).Do(); err != nil {
+			glog.Errorf("updating Binary Authorization attestor %s: %v", name, err)
+			return withCondition(aa.Status, corev1.ConditionFalse, "UpdateFailed", err.Error())
+		}
+		return withCondition(aa.Status, corev1.ConditionTrue, "Updated", "attestor up to date")
+	}
+}
+
+// Delete removes the Attestor backing aa. It is safe to call when the
+// Attestor doesn't exist, so the AttestationAuthority finalizer can call it
+// unconditionally during garbage collection.
+func (s *Syncer) Delete(aa kritisv1beta1.AttestationAuthority) error {
+	if !s.Enabled {
+		return nil
+	}
+	name := attestorName(s.project, aa.Name)
+	if _, err := s.client.Projects.Attestors.Delete(name).Do(); err != nil && !isNotFound(err) {
+		return fmt.Errorf("deleting Binary Authorization attestor %s: %v", name, err)
+	}
+	return nil
+}
+
+func attestorName(project, aaName string) string {
+	return fmt.Sprintf("projects/%s/attestors/%s", project, aaName)
+}
+
+func publicKey(aa kritisv1beta1.AttestationAuthority, publicKeyData string) (*binauthzv1.AttestorPublicKey, error) {
+	key := &binauthzv1.AttestorPublicKey{Id: aa.PrivateKeySecretName}
+	if aa.SignatureFormat == kritisv1beta1.CosignSignatureFormat {
+		algorithm, err := util.CosignSignatureAlgorithm(publicKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("determining signature algorithm for AttestationAuthority %s: %v", aa.Name, err)
+		}
+		key.PkixPublicKey = &binauthzv1.PkixPublicKey{
+			PublicKeyPem:       publicKeyData,
+			SignatureAlgorithm: algorithm,
+		}
+		return key, nil
+	}
+	key.AsciiArmoredPgpPublicKey = publicKeyData
+	return key, nil
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == 404
+}
+
+// withCondition upserts the BinaryAuthorizationSynced condition on status,
+// following the Kubernetes convention of only advancing LastTransitionTime
+// when Status actually changes.
+func withCondition(status kritisv1beta1.AttestationAuthorityStatus, conditionStatus corev1.ConditionStatus, reason, message string) kritisv1beta1.AttestationAuthorityStatus {
+	transitionTime := metav1.Now()
+	conditions := make([]kritisv1beta1.AttestationAuthorityCondition, 0, len(status.Conditions)+1)
+	for _, c := range status.Conditions {
+		if c.Type == kritisv1beta1.BinaryAuthorizationSynced {
+			if c.Status == conditionStatus {
+				transitionTime = c.LastTransitionTime
+			}
+			continue
+		}
+		conditions = append(conditions, c)
+	}
+	conditions = append(conditions, kritisv1beta1.AttestationAuthorityCondition{
+		Type:               kritisv1beta1.BinaryAuthorizationSynced,
+		Status:             conditionStatus,
+		LastTransitionTime: transitionTime,
+		Reason:             reason,
+		Message:            message,
+	})
+	status.Conditions = conditions
+	return status
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binauthz
+
+import (
+	"testing"
+	"time"
+
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncDisabledSetsFalseCondition(t *testing.T) {
+	s := NewSyncer(nil, "my-project", false)
+	aa := kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+
+	status := s.Sync(aa, "-----BEGIN PGP PUBLIC KEY BLOCK-----")
+	if len(status.Conditions) != 1 {
+		t.Fatalf("got %d conditions, want 1", len(status.Conditions))
+	}
+	cond := status.Conditions[0]
+	if cond.Type != kritisv1beta1.BinaryAuthorizationSynced {
+		t.Errorf("condition type = %v, want %v", cond.Type, kritisv1beta1.BinaryAuthorizationSynced)
+	}
+	if cond.Status != corev1.ConditionFalse {
+		t.Errorf("condition status = %v, want %v", cond.Status, corev1.ConditionFalse)
+	}
+	if cond.Reason != "Disabled" {
+		t.Errorf("condition reason = %q, want %q", cond.Reason, "Disabled")
+	}
+}
+
+func TestDeleteDisabledIsNoOp(t *testing.T) {
+	s := NewSyncer(nil, "my-project", false)
+	aa := kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+
+	if err := s.Delete(aa); err != nil {
+		t.Errorf("Delete() on disabled Syncer = %v, want nil", err)
+	}
+}
+
+// ecdsaP256PublicKeyPEM is an arbitrary P-256 public key, used to exercise
+// the cosign branch of publicKey(), which must parse the PEM to determine
+// its SignatureAlgorithm.
+const ecdsaP256PublicKeyPEM = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEa0BNlyXUN1rs9aGFHnslgsHRck2l
+h0F6Rpp2MC8OWLKUjQeQR7boD79kSnBptHLtIInKT3EK/mpir4L12tEOkg==
+-----END PUBLIC KEY-----`
+
+func TestPublicKeyByFormat(t *testing.T) {
+	aa := kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+	aa.PrivateKeySecretName = "my-secret"
+
+	pgp, err := publicKey(aa, "pgp-data")
+	if err != nil {
+		t.Fatalf("publicKey() for PGP format = %v, want nil error", err)
+	}
+	if pgp.AsciiArmoredPgpPublicKey != "pgp-data" || pgp.PkixPublicKey != nil {
+		t.Errorf("pgp key = %+v, want AsciiArmoredPgpPublicKey set and PkixPublicKey nil", pgp)
+	}
+
+	aa.SignatureFormat = kritisv1beta1.CosignSignatureFormat
+	cosign, err := publicKey(aa, ecdsaP256PublicKeyPEM)
+	if err != nil {
+		t.Fatalf("publicKey() for cosign format = %v, want nil error", err)
+	}
+	if cosign.PkixPublicKey == nil || cosign.PkixPublicKey.PublicKeyPem != ecdsaP256PublicKeyPEM {
+		t.Errorf("cosign key = %+v, want PkixPublicKey.PublicKeyPem set", cosign)
+	}
+	if cosign.PkixPublicKey.SignatureAlgorithm != "ECDSA_P256_SHA256" {
+		t.Errorf("cosign key SignatureAlgorithm = %q, want %q", cosign.PkixPublicKey.SignatureAlgorithm, "ECDSA_P256_SHA256")
+	}
+}
+
+func TestPublicKeyRejectsInvalidCosignKey(t *testing.T) {
+	aa := kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+	aa.SignatureFormat = kritisv1beta1.CosignSignatureFormat
+
+	if _, err := publicKey(aa, "not-a-pem-key"); err == nil {
+		t.Error("publicKey() with an unparseable cosign public key = nil error, want error")
+	}
+}
+
+func TestWithConditionPreservesTransitionTimeWhenUnchanged(t *testing.T) {
+	first := withCondition(kritisv1beta1.AttestationAuthorityStatus{}, corev1.ConditionTrue, "Created", "attestor created")
+	second := withCondition(first, corev1.ConditionTrue, "Updated", "attestor up to date")
+
+	if len(second.Conditions) != 1 {
+		t.Fatalf("got %d conditions, want 1", len(second.Conditions))
+	}
+	if !second.Conditions[0].LastTransitionTime.Equal(&first.Conditions[0].LastTransitionTime) {
+		t.Errorf("LastTransitionTime changed from %v to %v with an unchanged Status", first.Conditions[0].LastTransitionTime, second.Conditions[0].LastTransitionTime)
+	}
+	if second.Conditions[0].Reason != "Updated" {
+		t.Errorf("condition reason = %q, want %q", second.Conditions[0].Reason, "Updated")
+	}
+}
+
+func TestWithConditionAdvancesTransitionTimeOnStatusChange(t *testing.T) {
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	first := kritisv1beta1.AttestationAuthorityStatus{Conditions: []kritisv1beta1.AttestationAuthorityCondition{{
+		Type:               kritisv1beta1.BinaryAuthorizationSynced,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: past,
+	}}}
+	second := withCondition(first, corev1.ConditionTrue, "Created", "attestor created")
+
+	if second.Conditions[0].LastTransitionTime.Equal(&past) {
+		t.Errorf("LastTransitionTime did not advance across a Status change")
+	}
+}
+
+func TestAttestorName(t *testing.T) {
+	got := attestorName("my-project", "my-authority")
+	want := "projects/my-project/attestors/my-authority"
+	if got != want {
+		t.Errorf("attestorName() = %q, want %q", got, want)
+	}
+}
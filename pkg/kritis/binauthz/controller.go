@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binauthz
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/glog"
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Finalizer is added to every AttestationAuthority Controller reconciles,
+// so its Binary Authorization Attestor is garbage collected before the
+// AttestationAuthority itself is allowed to be deleted.
+const Finalizer = "binauthz.kritis.grafeas.io/finalizer"
+
+// SecretGetter fetches the Kubernetes Secret backing an
+// AttestationAuthority's signing key. Satisfied by a generated Secret
+// lister/clientset in production; a fake in tests.
+type SecretGetter interface {
+	GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+}
+
+// AttestationAuthorityUpdater persists the finalizer and status changes
+// Controller.Reconcile makes to an AttestationAuthority. Satisfied by a
+// generated Kritis clientset in production; a fake in tests.
+type AttestationAuthorityUpdater interface {
+	Update(ctx context.Context, aa *kritisv1beta1.AttestationAuthority) error
+	UpdateStatus(ctx context.Context, aa *kritisv1beta1.AttestationAuthority) error
+}
+
+// Controller reconciles AttestationAuthority resources against Binary
+// Authorization: it reads the referenced signing Secret's public key,
+// upserts the matching Attestor via Syncer, and garbage-collects that
+// Attestor once the AttestationAuthority is deleted.
+type Controller struct {
+	Syncer    *Syncer
+	Secrets   SecretGetter
+	Updater   AttestationAuthorityUpdater
+	Namespace string
+}
+
+// NewController returns a Controller that reconciles AttestationAuthority
+// resources in namespace, using syncer to talk to Binary Authorization.
+func NewController(syncer *Syncer, secretGetter SecretGetter, updater AttestationAuthorityUpdater, namespace string) *Controller {
+	return &Controller{Syncer: syncer, Secrets: secretGetter, Updater: updater, Namespace: namespace}
+}
+
+// Reconcile upserts or removes the Binary Authorization Attestor backing
+// aa and persists the resulting finalizer and status changes. It is safe to
+// call repeatedly, including for an aa already being deleted.
+func (c *Controller) Reconcile(ctx context.Context, aa *kritisv1beta1.AttestationAuthority) error {
+	if aa.DeletionTimestamp != nil {
+		return c.reconcileDeletion(ctx, aa)
+	}
+
+	if !hasFinalizer(aa, Finalizer) {
+		aa.Finalizers = append(aa.Finalizers, Finalizer)
+		if err := c.Updater.Update(ctx, aa); err != nil {
+			return fmt.Errorf("adding finalizer to AttestationAuthority %s: %v", aa.Name, err)
+		}
+	}
+
+	publicKeyData, err := c.publicKey(ctx, aa)
+	if err != nil {
+		glog.Errorf("reading signing secret for AttestationAuthority %s: %v", aa.Name, err)
+		aa.Status = withCondition(aa.Status, corev1.ConditionFalse, "SecretReadFailed", err.Error())
+		return c.Updater.UpdateStatus(ctx, aa)
+	}
+
+	aa.Status = c.Syncer.Sync(*aa, publicKeyData)
+	return c.Updater.UpdateStatus(ctx, aa)
+}
+
+// reconcileDeletion removes the Binary Authorization Attestor backing aa
+// and clears Finalizer, letting the API server finish deleting aa.
+func (c *Controller) reconcileDeletion(ctx context.Context, aa *kritisv1beta1.AttestationAuthority) error {
+	if !hasFinalizer(aa, Finalizer) {
+		return nil
+	}
+	if err := c.Syncer.Delete(*aa); err != nil {
+		return fmt.Errorf("deleting Binary Authorization attestor for AttestationAuthority %s: %v", aa.Name, err)
+	}
+	aa.Finalizers = removeFinalizer(aa.Finalizers, Finalizer)
+	return c.Updater.Update(ctx, aa)
+}
+
+// publicKey reads and extracts the public key material from the Secret
+// aa.PrivateKeySecretName names.
+func (c *Controller) publicKey(ctx context.Context, aa *kritisv1beta1.AttestationAuthority) (string, error) {
+	secret, err := c.Secrets.GetSecret(ctx, c.Namespace, aa.PrivateKeySecretName)
+	if err != nil {
+		return "", fmt.Errorf("getting secret %s/%s: %v", c.Namespace, aa.PrivateKeySecretName, err)
+	}
+	return secrets.PublicKeyFromSecret(secret)
+}
+
+func hasFinalizer(aa *kritisv1beta1.AttestationAuthority, name string) bool {
+	for _, f := range aa.Finalizers {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(finalizers []string, name string) []string {
+	out := make([]string, 0, len(finalizers))
+	for _, f := range finalizers {
+		if f != name {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binauthz
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeSecretGetter struct {
+	secret *corev1.Secret
+	err    error
+}
+
+func (f fakeSecretGetter) GetSecret(_ context.Context, _, _ string) (*corev1.Secret, error) {
+	return f.secret, f.err
+}
+
+type fakeUpdater struct {
+	updated       *kritisv1beta1.AttestationAuthority
+	statusUpdated *kritisv1beta1.AttestationAuthority
+}
+
+func (f *fakeUpdater) Update(_ context.Context, aa *kritisv1beta1.AttestationAuthority) error {
+	f.updated = aa
+	return nil
+}
+
+func (f *fakeUpdater) UpdateStatus(_ context.Context, aa *kritisv1beta1.AttestationAuthority) error {
+	f.statusUpdated = aa
+	return nil
+}
+
+func TestReconcileAddsFinalizerAndSyncsStatus(t *testing.T) {
+	secretGetter := fakeSecretGetter{secret: &corev1.Secret{
+		Data: map[string][]byte{secrets.PublicKeyDataKey: []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")},
+	}}
+	updater := &fakeUpdater{}
+	c := NewController(NewSyncer(nil, "my-project", false), secretGetter, updater, "kritis")
+
+	aa := &kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+	aa.PrivateKeySecretName = "my-secret"
+
+	if err := c.Reconcile(context.Background(), aa); err != nil {
+		t.Fatalf("Reconcile() = %v, want nil", err)
+	}
+	if !hasFinalizer(aa, Finalizer) {
+		t.Errorf("Reconcile() did not add finalizer %q", Finalizer)
+	}
+	if updater.updated == nil {
+		t.Fatalf("Update() was not called to persist the finalizer")
+	}
+	if updater.statusUpdated == nil || len(updater.statusUpdated.Status.Conditions) != 1 {
+		t.Fatalf("UpdateStatus() = %+v, want one condition recorded", updater.statusUpdated)
+	}
+	if cond := updater.statusUpdated.Status.Conditions[0]; cond.Reason != "Disabled" {
+		t.Errorf("condition reason = %q, want %q", cond.Reason, "Disabled")
+	}
+}
+
+func TestReconcileRecordsSecretReadFailure(t *testing.T) {
+	secretGetter := fakeSecretGetter{err: fmt.Errorf("secret not found")}
+	updater := &fakeUpdater{}
+	c := NewController(NewSyncer(nil, "my-project", true), secretGetter, updater, "kritis")
+
+	aa := &kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+	aa.Finalizers = []string{Finalizer}
+
+	if err := c.Reconcile(context.Background(), aa); err != nil {
+		t.Fatalf("Reconcile() = %v, want nil", err)
+	}
+	if updater.updated != nil {
+		t.Errorf("Update() was called, want only UpdateStatus() when the finalizer is already present")
+	}
+	cond := updater.statusUpdated.Status.Conditions[0]
+	if cond.Reason != "SecretReadFailed" || cond.Status != corev1.ConditionFalse {
+		t.Errorf("condition = %+v, want SecretReadFailed/False", cond)
+	}
+}
+
+func TestReconcileDeletionRemovesFinalizer(t *testing.T) {
+	updater := &fakeUpdater{}
+	c := NewController(NewSyncer(nil, "my-project", false), fakeSecretGetter{}, updater, "kritis")
+
+	aa := &kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+	aa.Finalizers = []string{Finalizer}
+	now := metav1.Now()
+	aa.DeletionTimestamp = &now
+
+	if err := c.Reconcile(context.Background(), aa); err != nil {
+		t.Fatalf("Reconcile() = %v, want nil", err)
+	}
+	if hasFinalizer(aa, Finalizer) {
+		t.Errorf("Reconcile() did not remove finalizer %q", Finalizer)
+	}
+	if updater.updated == nil {
+		t.Fatalf("Update() was not called to persist finalizer removal")
+	}
+}
+
+func TestReconcileDeletionWithoutFinalizerIsNoOp(t *testing.T) {
+	updater := &fakeUpdater{}
+	c := NewController(NewSyncer(nil, "my-project", false), fakeSecretGetter{}, updater, "kritis")
+
+	aa := &kritisv1beta1.AttestationAuthority{}
+	aa.Name = "my-authority"
+	now := metav1.Now()
+	aa.DeletionTimestamp = &now
+
+	if err := c.Reconcile(context.Background(), aa); err != nil {
+		t.Fatalf("Reconcile() = %v, want nil", err)
+	}
+	if updater.updated != nil {
+		t.Errorf("Update() was called, want no-op when finalizer is already absent")
+	}
+}
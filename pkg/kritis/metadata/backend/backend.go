@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backend constructs the metadata.Fetcher a MetadataBackend
+// resource configures, reading its CredentialsSecretName for client
+// credentials. It lives outside package metadata to avoid an import cycle,
+// since metadata.Fetcher is implemented by both backends it constructs.
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/metadata/containeranalysis"
+	"github.com/grafeas/kritis/pkg/kritis/metadata/grafeas"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// backendTypeFlag backs the --metadata-backend controller flag, which
+// selects the MetadataBackendType Kritis runs against when no
+// MetadataBackend resource exists in the cluster.
+var backendTypeFlag = flag.String("metadata-backend", string(kritisv1beta1.ContainerAnalysisBackend), "MetadataBackendType to use when no MetadataBackend resource exists (ContainerAnalysis or Grafeas)")
+
+// SecretGetter fetches the Kubernetes Secret a MetadataBackend's
+// CredentialsSecretName refers to.
+type SecretGetter interface {
+	GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+}
+
+// New constructs the metadata.Fetcher mb configures for project, reading
+// mb.CredentialsSecretName from namespace via secretGetter for client
+// credentials. mb may be nil, in which case the --metadata-backend flag
+// selects the backend and it is constructed with no credentials Secret
+// (Container Analysis's Application Default Credentials, or an insecure
+// connection to a self-hosted Grafeas server).
+func New(ctx context.Context, mb *kritisv1beta1.MetadataBackend, secretGetter SecretGetter, namespace, project string) (metadata.Fetcher, error) {
+	backendType := kritisv1beta1.MetadataBackendType(*backendTypeFlag)
+	var address, credentialsSecretName string
+	if mb != nil {
+		backendType = mb.Type
+		address = mb.Address
+		credentialsSecretName = mb.CredentialsSecretName
+	}
+
+	var secret *corev1.Secret
+	if credentialsSecretName != "" {
+		s, err := secretGetter.GetSecret(ctx, namespace, credentialsSecretName)
+		if err != nil {
+			return nil, fmt.Errorf("getting metadata backend credentials secret %s/%s: %v", namespace, credentialsSecretName, err)
+		}
+		secret = s
+	}
+
+	switch backendType {
+	case kritisv1beta1.GrafeasBackend:
+		dialOpts, err := grafeasDialOptions(secret)
+		if err != nil {
+			return nil, err
+		}
+		return grafeas.NewGrafeasClient(address, project, dialOpts...)
+	case kritisv1beta1.ContainerAnalysisBackend, "":
+		opts, err := containerAnalysisClientOptions(secret)
+		if err != nil {
+			return nil, err
+		}
+		return containeranalysis.NewContainerAnalysisClient(project, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported metadata backend type %q", backendType)
+	}
+}
+
+// containerAnalysisClientOptions builds the option.ClientOption a
+// ContainerAnalysis client should authenticate with, from a GCP service
+// account key stored under "key.json" in secret.
+func containerAnalysisClientOptions(secret *corev1.Secret) ([]option.ClientOption, error) {
+	if secret == nil {
+		return nil, nil
+	}
+	key, ok := secret.Data["key.json"]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no %q data key", secret.Namespace, secret.Name, "key.json")
+	}
+	return []option.ClientOption{option.WithCredentialsJSON(key)}, nil
+}
+
+// grafeasDialOptions builds the grpc.DialOption a Grafeas client should
+// connect with. With no secret, it dials insecurely, for a self-hosted
+// Grafeas server running without TLS. With a secret, it expects the
+// standard Kubernetes TLS Secret data keys (tls.crt, tls.key) plus an
+// optional ca.crt to verify the server against.
+func grafeasDialOptions(secret *corev1.Secret) ([]grpc.DialOption, error) {
+	if secret == nil {
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	}
+	cert, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("parsing TLS client cert from secret %s/%s: %v", secret.Namespace, secret.Name, err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if ca := secret.Data["ca.crt"]; len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("parsing ca.crt from secret %s/%s", secret.Namespace, secret.Name)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}, nil
+}
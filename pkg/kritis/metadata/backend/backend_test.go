@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestContainerAnalysisClientOptionsNoSecret(t *testing.T) {
+	opts, err := containerAnalysisClientOptions(nil)
+	if err != nil {
+		t.Fatalf("containerAnalysisClientOptions(nil) = %v, want nil error", err)
+	}
+	if len(opts) != 0 {
+		t.Errorf("got %d options, want 0", len(opts))
+	}
+}
+
+func TestContainerAnalysisClientOptionsMissingKey(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{}}
+	if _, err := containerAnalysisClientOptions(secret); err == nil {
+		t.Error("containerAnalysisClientOptions() with no key.json data = nil error, want error")
+	}
+}
+
+func TestContainerAnalysisClientOptionsWithKey(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"key.json": []byte(`{}`)}}
+	opts, err := containerAnalysisClientOptions(secret)
+	if err != nil {
+		t.Fatalf("containerAnalysisClientOptions() = %v, want nil error", err)
+	}
+	if len(opts) != 1 {
+		t.Errorf("got %d options, want 1", len(opts))
+	}
+}
+
+func TestGrafeasDialOptionsNoSecret(t *testing.T) {
+	opts, err := grafeasDialOptions(nil)
+	if err != nil {
+		t.Fatalf("grafeasDialOptions(nil) = %v, want nil error", err)
+	}
+	if len(opts) != 1 {
+		t.Errorf("got %d dial options, want 1 (insecure)", len(opts))
+	}
+}
+
+func TestGrafeasDialOptionsInvalidCert(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"tls.crt": []byte("not a cert"), "tls.key": []byte("not a key")}}
+	if _, err := grafeasDialOptions(secret); err == nil {
+		t.Error("grafeasDialOptions() with an invalid cert = nil error, want error")
+	}
+}
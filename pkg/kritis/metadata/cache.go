@@ -0,0 +1,222 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// cacheMaxEntries and cacheTTL back the --metadata-cache-max-entries and
+// --metadata-cache-ttl controller flags, which size the CachingFetcher.
+// NewCachingFetcherFromFlags reads them.
+var (
+	cacheMaxEntries = flag.Int("metadata-cache-max-entries", 1000, "maximum number of vulnerability/attestation lookups the metadata cache retains")
+	cacheTTL        = flag.Duration("metadata-cache-ttl", 5*time.Minute, "how long a cached vulnerability or attestation lookup is served before it is refetched")
+)
+
+var (
+	cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kritis",
+		Subsystem: "metadata_cache",
+		Name:      "hits_total",
+		Help:      "Number of metadata cache lookups served without an upstream call, by kind.",
+	}, []string{"kind"})
+	cacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kritis",
+		Subsystem: "metadata_cache",
+		Name:      "misses_total",
+		Help:      "Number of metadata cache lookups that required an upstream call, by kind.",
+	}, []string{"kind"})
+	upstreamRPCs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kritis",
+		Subsystem: "metadata_cache",
+		Name:      "upstream_rpcs_total",
+		Help:      "Number of ListOccurrences RPCs actually issued to the metadata backend, by kind.",
+	}, []string{"kind"})
+)
+
+func init() {
+	prometheus.MustRegister(cacheHits, cacheMisses, upstreamRPCs)
+}
+
+const (
+	vulnerabilityCacheKind = "vulnerability"
+	attestationCacheKind   = "attestation"
+)
+
+type cacheEntry struct {
+	vulnz        []Vulnerability
+	attestations []Attestation
+	expiresAt    time.Time
+}
+
+// CachingFetcher wraps a Fetcher with a TTL+LRU cache keyed by
+// (containerImage, policy) for vulnerabilities and containerImage for
+// attestations, plus a singleflight.Group that coalesces concurrent lookups
+// for the same key into a single upstream call. This keeps a Deployment
+// rollout with N replicas, or a burst of admission reviews for one image,
+// from issuing N ListOccurrences RPCs.
+type CachingFetcher struct {
+	Fetcher
+	cache *lru.Cache
+	ttl   time.Duration
+	group singleflight.Group
+	mu    sync.Mutex
+}
+
+var _ Fetcher = (*CachingFetcher)(nil)
+
+// NewCachingFetcher wraps fetcher with an LRU cache holding up to maxEntries
+// entries, each valid for ttl.
+func NewCachingFetcher(fetcher Fetcher, maxEntries int, ttl time.Duration) (*CachingFetcher, error) {
+	cache, err := lru.New(maxEntries)
+	if err != nil {
+		return nil, err
+	}
+	return &CachingFetcher{Fetcher: fetcher, cache: cache, ttl: ttl}, nil
+}
+
+// NewCachingFetcherFromFlags wraps fetcher with an LRU cache sized by the
+// --metadata-cache-max-entries and --metadata-cache-ttl flags.
+func NewCachingFetcherFromFlags(fetcher Fetcher) (*CachingFetcher, error) {
+	return NewCachingFetcher(fetcher, *cacheMaxEntries, *cacheTTL)
+}
+
+func (c *CachingFetcher) GetVulnerabilities(containerImage string, policy VulnerabilityPolicy) ([]Vulnerability, error) {
+	key := vulnCacheKey(containerImage, policy)
+	if entry, ok := c.get(key); ok {
+		cacheHits.WithLabelValues(vulnerabilityCacheKind).Inc()
+		return entry.vulnz, nil
+	}
+	cacheMisses.WithLabelValues(vulnerabilityCacheKind).Inc()
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		upstreamRPCs.WithLabelValues(vulnerabilityCacheKind).Inc()
+		vulnz, err := c.Fetcher.GetVulnerabilities(containerImage, policy)
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, cacheEntry{vulnz: vulnz})
+		return vulnz, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]Vulnerability), nil
+}
+
+func (c *CachingFetcher) GetAttestations(containerImage string) ([]Attestation, error) {
+	key := attestationCacheKey(containerImage)
+	if entry, ok := c.get(key); ok {
+		cacheHits.WithLabelValues(attestationCacheKind).Inc()
+		return entry.attestations, nil
+	}
+	cacheMisses.WithLabelValues(attestationCacheKind).Inc()
+	a, err, _ := c.group.Do(key, func() (interface{}, error) {
+		upstreamRPCs.WithLabelValues(attestationCacheKind).Inc()
+		attestations, err := c.Fetcher.GetAttestations(containerImage)
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, cacheEntry{attestations: attestations})
+		return attestations, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.([]Attestation), nil
+}
+
+// CreateAttestationOccurence creates the occurrence via the wrapped Fetcher,
+// then invalidates containerImage's cached attestations so a subsequent
+// GetAttestations observes it immediately.
+func (c *CachingFetcher) CreateAttestationOccurence(note *containeranalysispb.Note, containerImage string, signingKey SigningKey) (*containeranalysispb.Occurrence, error) {
+	occ, err := c.Fetcher.CreateAttestationOccurence(note, containerImage, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	c.Refresh(containerImage)
+	return occ, nil
+}
+
+// Refresh invalidates containerImage's cached vulnerabilities and
+// attestations, so the next lookup goes to the backend instead of serving
+// stale data.
+func (c *CachingFetcher) Refresh(containerImage string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range c.cache.Keys() {
+		key, ok := k.(string)
+		if !ok {
+			continue
+		}
+		if keyMatchesImage(key, containerImage) {
+			c.cache.Remove(k)
+		}
+	}
+}
+
+func (c *CachingFetcher) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.cache.Get(key)
+	if !ok {
+		return cacheEntry{}, false
+	}
+	entry := v.(cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.cache.Remove(key)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *CachingFetcher) set(key string, entry cacheEntry) {
+	entry.expiresAt = time.Now().Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.Add(key, entry)
+}
+
+func vulnCacheKey(containerImage string, policy VulnerabilityPolicy) string {
+	return fmt.Sprintf("%s:%s:%s:%v:%v:%v", vulnerabilityCacheKind, containerImage, policy.MinSeverity, policy.OnlyFixable, policy.AllowlistCVEs, policy.BlocklistCVEs)
+}
+
+func attestationCacheKey(containerImage string) string {
+	return fmt.Sprintf("%s:%s", attestationCacheKind, containerImage)
+}
+
+// keyMatchesImage reports whether key is a vulnerability or attestation
+// cache key for containerImage. It anchors on the full
+// "vulnerability:<image>:" segment rather than a bare prefix compare, so an
+// image whose name is itself a prefix of another (e.g. "gcr.io/foo" vs.
+// "gcr.io/foobar") can't evict or match the wrong entry.
+func keyMatchesImage(key, containerImage string) bool {
+	prefix := fmt.Sprintf("%s:%s:", vulnerabilityCacheKind, containerImage)
+	if strings.HasPrefix(key, prefix) {
+		return true
+	}
+	return key == attestationCacheKey(containerImage)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// countingFetcher wraps a Fetcher and counts calls to GetVulnerabilities, so
+// tests can assert the cache avoided redundant upstream calls.
+type countingFetcher struct {
+	Fetcher
+	vulnCalls int32
+}
+
+func (f *countingFetcher) GetVulnerabilities(containerImage string, policy VulnerabilityPolicy) ([]Vulnerability, error) {
+	atomic.AddInt32(&f.vulnCalls, 1)
+	return []Vulnerability{{CVE: "CVE-1", Severity: SeverityHigh}}, nil
+}
+
+func (f *countingFetcher) GetAttestations(containerImage string) ([]Attestation, error) {
+	return nil, nil
+}
+
+func (f *countingFetcher) CreateAttestationOccurence(note *containeranalysispb.Note, containerImage string, signingKey SigningKey) (*containeranalysispb.Occurrence, error) {
+	return &containeranalysispb.Occurrence{}, nil
+}
+
+func (f *countingFetcher) DeleteAttestationNote(aa kritisv1beta1.AttestationAuthority) error {
+	return nil
+}
+func (f *countingFetcher) DeleteOccurrence(occurrenceId string) error { return nil }
+func (f *countingFetcher) CreateAttestationNote(aa kritisv1beta1.AttestationAuthority) error {
+	return nil
+}
+func (f *countingFetcher) GetAttestationNote(aa kritisv1beta1.AttestationAuthority) (*containeranalysispb.Note, error) {
+	return nil, nil
+}
+
+func TestCachingFetcherServesRepeatLookupsFromCache(t *testing.T) {
+	inner := &countingFetcher{}
+	cached, err := NewCachingFetcher(inner, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewCachingFetcher() error = %v", err)
+	}
+
+	policy := VulnerabilityPolicy{MinSeverity: SeverityLow}
+	for i := 0; i < 5; i++ {
+		if _, err := cached.GetVulnerabilities("gcr.io/proj/image", policy); err != nil {
+			t.Fatalf("GetVulnerabilities() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&inner.vulnCalls); got != 1 {
+		t.Errorf("upstream GetVulnerabilities called %d times, want 1", got)
+	}
+
+	// A different policy is a different cache key, so it must re-fetch.
+	if _, err := cached.GetVulnerabilities("gcr.io/proj/image", VulnerabilityPolicy{MinSeverity: SeverityCritical}); err != nil {
+		t.Fatalf("GetVulnerabilities() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&inner.vulnCalls); got != 2 {
+		t.Errorf("upstream GetVulnerabilities called %d times, want 2", got)
+	}
+
+	cached.Refresh("gcr.io/proj/image")
+	if _, err := cached.GetVulnerabilities("gcr.io/proj/image", policy); err != nil {
+		t.Fatalf("GetVulnerabilities() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&inner.vulnCalls); got != 3 {
+		t.Errorf("upstream GetVulnerabilities called %d times after Refresh, want 3", got)
+	}
+}
+
+func TestKeyMatchesImageDoesNotMatchOnPrefixOverlap(t *testing.T) {
+	key := vulnCacheKey("gcr.io/proj/image-extended", VulnerabilityPolicy{MinSeverity: SeverityLow})
+	if keyMatchesImage(key, "gcr.io/proj/image") {
+		t.Errorf("keyMatchesImage(%q, %q) = true, want false", key, "gcr.io/proj/image")
+	}
+	if !keyMatchesImage(key, "gcr.io/proj/image-extended") {
+		t.Errorf("keyMatchesImage(%q, %q) = false, want true", key, "gcr.io/proj/image-extended")
+	}
+}
+
+func TestRefreshDoesNotEvictSimilarlyPrefixedImage(t *testing.T) {
+	inner := &countingFetcher{}
+	cached, err := NewCachingFetcher(inner, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewCachingFetcher() error = %v", err)
+	}
+	policy := VulnerabilityPolicy{MinSeverity: SeverityLow}
+
+	if _, err := cached.GetVulnerabilities("gcr.io/proj/image-extended", policy); err != nil {
+		t.Fatalf("GetVulnerabilities() error = %v", err)
+	}
+	cached.Refresh("gcr.io/proj/image")
+	if _, err := cached.GetVulnerabilities("gcr.io/proj/image-extended", policy); err != nil {
+		t.Fatalf("GetVulnerabilities() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&inner.vulnCalls); got != 1 {
+		t.Errorf("upstream GetVulnerabilities called %d times, want 1 (Refresh of an unrelated image evicted this entry)", got)
+	}
+}
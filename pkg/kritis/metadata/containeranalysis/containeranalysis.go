@@ -27,10 +27,10 @@ import (
 	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
 	"github.com/grafeas/kritis/pkg/kritis/constants"
 	"github.com/grafeas/kritis/pkg/kritis/metadata"
-	"github.com/grafeas/kritis/pkg/kritis/secrets"
 	"github.com/grafeas/kritis/pkg/kritis/util"
 	"golang.org/x/net/context"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
 )
 
@@ -40,60 +40,89 @@ const (
 	AttestationAuthority = "ATTESTATION_AUTHORITY"
 )
 
-// The ContainerAnalysis struct implements MetadataFetcher Interface.
+// The ContainerAnalysis struct implements the metadata.Fetcher interface.
+var _ metadata.Fetcher = ContainerAnalysis{}
+
+// ContainerAnalysis talks to Google Container Analysis. Notes and
+// Occurrences are stored under project, which is supplied at construction
+// time rather than parsed out of the image reference, so that images in
+// any registry (not just gcr.io) can be looked up.
 type ContainerAnalysis struct {
-	client *gen.Client
-	ctx    context.Context
+	client  *gen.Client
+	ctx     context.Context
+	project string
 }
 
-func NewContainerAnalysisClient() (*ContainerAnalysis, error) {
+// NewContainerAnalysisClient returns a ContainerAnalysis client that stores
+// Notes and Occurrences under project, authenticating with opts (e.g.
+// option.WithCredentialsJSON for a service account key read from a
+// MetadataBackend's credentials Secret) or, absent any, Application
+// Default Credentials.
+func NewContainerAnalysisClient(project string, opts ...option.ClientOption) (*ContainerAnalysis, error) {
 	ctx := context.Background()
-	client, err := gen.NewClient(ctx)
+	client, err := gen.NewClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &ContainerAnalysis{
-		client: client,
-		ctx:    ctx,
+		client:  client,
+		ctx:     ctx,
+		project: project,
 	}, nil
 }
 
-// GetVulnerabilites gets Package Vulnerabilities Occurrences for a specified image.
-func (c ContainerAnalysis) GetVulnerabilities(containerImage string) ([]metadata.Vulnerability, error) {
+// GetVulnerabilities gets Package Vulnerabilities Occurrences for a
+// specified image, dropping anything policy disallows and logging each
+// surviving vulnerability so triage in cluster logs reflects what's being
+// enforced against.
+func (c ContainerAnalysis) GetVulnerabilities(containerImage string, policy metadata.VulnerabilityPolicy) ([]metadata.Vulnerability, error) {
 	occs, err := c.fethcOccurrence(containerImage, PkgVulnerability)
 	if err != nil {
 		return nil, err
 	}
 	vulnz := []metadata.Vulnerability{}
 	for _, occ := range occs {
-		vulnz = append(vulnz, GetVulnerabilityFromOccurence(occ))
+		for _, v := range GetVulnerabilitiesFromOccurence(occ) {
+			if !policy.Allows(v) {
+				continue
+			}
+			metadata.LogVulnerability(containerImage, v)
+			vulnz = append(vulnz, v)
+		}
 	}
 	return vulnz, nil
 }
 
 // GetAttestation gets AttesationAuthority Occurrences for a specified image.
-func (c ContainerAnalysis) GetAttestations(containerImage string) ([]metadata.PgpAttestation, error) {
+// Each occurrence is returned as whichever signature format it was created
+// with; callers key off Attestation.Format to tell PGP and cosign
+// occurrences apart, since both are carried in the same Details oneof.
+func (c ContainerAnalysis) GetAttestations(containerImage string) ([]metadata.Attestation, error) {
 	occs, err := c.fethcOccurrence(containerImage, AttestationAuthority)
 	if err != nil {
 		return nil, err
 	}
-	pgpAttestations := make([]metadata.PgpAttestation, len(occs))
+	attestations := make([]metadata.Attestation, len(occs))
 	for i, occ := range occs {
-		pgpAttestations[i] = getPgpAttestationFromOccurrence(occ)
+		if cosign, err := metadata.DecodeCosignOccurrenceDetails(occ); err == nil {
+			attestations[i] = metadata.Attestation{Format: kritisv1beta1.CosignSignatureFormat, Cosign: cosign}
+			continue
+		}
+		attestations[i] = metadata.Attestation{Format: kritisv1beta1.PgpSignatureFormat, Pgp: getPgpAttestationFromOccurrence(occ)}
 	}
-	return pgpAttestations, nil
+	return attestations, nil
 }
 
 func (c ContainerAnalysis) fethcOccurrence(containerImage string, kind string) ([]*containeranalysispb.Occurrence, error) {
-	// Make sure container image valid and is a GCR image
-	if !isValidImageOnGCR(containerImage) {
-		return nil, fmt.Errorf("%s is not a valid image hosted in GCR", containerImage)
+	// Make sure containerImage is a reference any registry can resolve, not
+	// just gcr.io.
+	if !isValidImage(containerImage) {
+		return nil, fmt.Errorf("%s is not a valid image reference", containerImage)
 	}
-	project := strings.Split(containerImage, "/")[1]
 	req := &containeranalysispb.ListOccurrencesRequest{
 		Filter:   fmt.Sprintf("resource_url=%q AND kind=%q", getResourceUrl(containerImage), kind),
 		PageSize: constants.PageSize,
-		Parent:   fmt.Sprintf("projects/%s", project),
+		Parent:   fmt.Sprintf("projects/%s", c.project),
 	}
 	it := c.client.ListOccurrences(c.ctx, req)
 	occs := []*containeranalysispb.Occurrence{}
@@ -110,42 +139,56 @@ func (c ContainerAnalysis) fethcOccurrence(containerImage string, kind string) (
 	return occs, nil
 }
 
-func GetVulnerabilityFromOccurence(occ *containeranalysispb.Occurrence) metadata.Vulnerability {
+// GetVulnerabilitiesFromOccurence flattens occ into one Vulnerability per
+// affected package, so a VulnerabilityPolicy can make fix/severity decisions
+// per package rather than for the occurrence as a whole. An occurrence with
+// no PackageIssue entries still yields a single Vulnerability, so it isn't
+// silently dropped.
+func GetVulnerabilitiesFromOccurence(occ *containeranalysispb.Occurrence) []metadata.Vulnerability {
 	vulnDetails := occ.GetDetails().(*containeranalysispb.Occurrence_VulnerabilityDetails).VulnerabilityDetails
-	hasFixAvailable := isFixAvaliable(vulnDetails.GetPackageIssue())
-	vulnerability := metadata.Vulnerability{
-		Severity:        containeranalysispb.VulnerabilityType_Severity_name[int32(vulnDetails.Severity)],
-		HasFixAvailable: hasFixAvailable,
-		CVE:             occ.GetNoteName(),
+	severity := metadata.Severity(containeranalysispb.VulnerabilityType_Severity_name[int32(vulnDetails.Severity)])
+	issues := vulnDetails.GetPackageIssue()
+	if len(issues) == 0 {
+		return []metadata.Vulnerability{{
+			OccurrenceName: occ.GetName(),
+			CVE:            occ.GetNoteName(),
+			Severity:       severity,
+		}}
 	}
-	return vulnerability
-}
-
-func isFixAvaliable(pis []*containeranalysispb.VulnerabilityType_PackageIssue) bool {
-	for _, pi := range pis {
-		if pi.GetFixedLocation().GetVersion().Kind == containeranalysispb.VulnerabilityType_Version_MAXIMUM {
-			// If FixedLocation.Version.Kind = MAXIMUM then no fix is available. Return false
-			return false
+	vulnz := make([]metadata.Vulnerability, len(issues))
+	for i, pi := range issues {
+		hasFixAvailable := isFixAvailable(pi)
+		var fixedVersion string
+		if hasFixAvailable {
+			fixedVersion = pi.GetFixedLocation().GetVersion().GetName()
+		}
+		vulnz[i] = metadata.Vulnerability{
+			OccurrenceName:   occ.GetName(),
+			CVE:              occ.GetNoteName(),
+			Severity:         severity,
+			HasFixAvailable:  hasFixAvailable,
+			Package:          pi.GetAffectedLocation().GetPackage(),
+			InstalledVersion: pi.GetAffectedLocation().GetVersion().GetName(),
+			FixedVersion:     fixedVersion,
 		}
 	}
-	return true
+	return vulnz
 }
 
-func isValidImageOnGCR(containerImage string) bool {
-	ref, err := name.ParseReference(containerImage, name.WeakValidation)
-	if err != nil {
-		glog.Warning(err)
-		return false
-	}
-	return isRegistryGCR(ref.Context().RegistryStr())
+// isFixAvailable reports whether pi's fixed location is a real version, as
+// opposed to the MAXIMUM sentinel Container Analysis uses to mean "no fix
+// available yet".
+func isFixAvailable(pi *containeranalysispb.VulnerabilityType_PackageIssue) bool {
+	return pi.GetFixedLocation().GetVersion().GetKind() != containeranalysispb.VulnerabilityType_Version_MAXIMUM
 }
 
-func isRegistryGCR(r string) bool {
-	registry := strings.Split(r, ".")
-	if len(registry) < 2 {
-		return false
-	}
-	if registry[len(registry)-2] != "gcr" || registry[len(registry)-1] != "io" {
+// isValidImage reports whether containerImage parses as an image reference
+// go-containerregistry understands. This accepts images hosted on gcr.io,
+// Artifact Registry, ECR, GHCR, Docker Hub, Quay, and any other registry
+// implementing the Docker v2 API, not just GCR.
+func isValidImage(containerImage string) bool {
+	if _, err := name.ParseReference(containerImage, name.WeakValidation); err != nil {
+		glog.Warning(err)
 		return false
 	}
 	return true
@@ -202,31 +245,47 @@ func (c ContainerAnalysis) GetAttestationNote(aa kritisv1beta1.AttestationAuthor
 	return c.client.GetNote(c.ctx, req)
 }
 
+// CreateAttestationOccurence creates a signed attestation Occurrence against
+// note for containerImage, dispatching on signingKey.Format to sign with
+// either a PGP or a cosign key.
 func (c ContainerAnalysis) CreateAttestationOccurence(note *containeranalysispb.Note,
 	containerImage string,
-	pgpSigningKey *secrets.PgpSigningSecret) (*containeranalysispb.Occurrence, error) {
-	if !isValidImageOnGCR(containerImage) {
-		return nil, fmt.Errorf("%s is not a valid image hosted in GCR", containerImage)
-	}
-	// Create Attestation Signature
-	sig, err := util.CreateAttestationSignature(containerImage, pgpSigningKey)
-	if err != nil {
-		return nil, err
-	}
-	pgpSignedAttestation := &containeranalysispb.PgpSignedAttestation{
-		Signature: sig,
-		KeyId: &containeranalysispb.PgpSignedAttestation_PgpKeyId{
-			PgpKeyId: pgpSigningKey.SecretName,
-		},
+	signingKey metadata.SigningKey) (*containeranalysispb.Occurrence, error) {
+	if !isValidImage(containerImage) {
+		return nil, fmt.Errorf("%s is not a valid image reference", containerImage)
 	}
-
-	attestationDetails := &containeranalysispb.Occurrence_Attestation{
-		Attestation: &containeranalysispb.AttestationAuthority_Attestation{
-			Signature: &containeranalysispb.AttestationAuthority_Attestation_PgpSignedAttestation{
-				PgpSignedAttestation: pgpSignedAttestation,
+	var attestationDetails *containeranalysispb.Occurrence_Attestation
+	switch signingKey.Format {
+	case kritisv1beta1.CosignSignatureFormat:
+		envelope, err := util.CreateCosignAttestationSignature(containerImage, signingKey.Cosign)
+		if err != nil {
+			return nil, err
+		}
+		attestationDetails, err = metadata.EncodeCosignOccurrenceDetails(envelope, signingKey.Cosign.SecretName, signingKey.RekorLogURL)
+		if err != nil {
+			return nil, err
+		}
+	case kritisv1beta1.PgpSignatureFormat, "":
+		sig, err := util.CreateAttestationSignature(containerImage, signingKey.Pgp)
+		if err != nil {
+			return nil, err
+		}
+		attestationDetails = &containeranalysispb.Occurrence_Attestation{
+			Attestation: &containeranalysispb.AttestationAuthority_Attestation{
+				Signature: &containeranalysispb.AttestationAuthority_Attestation_PgpSignedAttestation{
+					PgpSignedAttestation: &containeranalysispb.PgpSignedAttestation{
+						Signature: sig,
+						KeyId: &containeranalysispb.PgpSignedAttestation_PgpKeyId{
+							PgpKeyId: signingKey.Pgp.SecretName,
+						},
+					},
+				},
 			},
-		},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signature format %q", signingKey.Format)
 	}
+
 	occ := &containeranalysispb.Occurrence{
 		ResourceUrl: getResourceUrl(containerImage),
 		NoteName:    note.GetName(),
@@ -235,7 +294,7 @@ func (c ContainerAnalysis) CreateAttestationOccurence(note *containeranalysispb.
 	// Create the AttestationAuthrity Occurence in the Project AttestationAuthority Note.
 	req := &containeranalysispb.CreateOccurrenceRequest{
 		Occurrence: occ,
-		Parent:     fmt.Sprintf("projects/%s", strings.Split(containerImage, "/")[1]),
+		Parent:     fmt.Sprintf("projects/%s", c.project),
 	}
 	// Call create Occurrence Api
 	return c.client.CreateOccurrence(c.ctx, req)
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containeranalysis
+
+import (
+	"testing"
+
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+func packageIssue(pkg, installed, fixed string, noFix bool) *containeranalysispb.VulnerabilityType_PackageIssue {
+	fixedKind := containeranalysispb.VulnerabilityType_Version_NORMAL
+	if noFix {
+		fixedKind = containeranalysispb.VulnerabilityType_Version_MAXIMUM
+	}
+	return &containeranalysispb.VulnerabilityType_PackageIssue{
+		AffectedLocation: &containeranalysispb.VulnerabilityLocation{
+			Package: pkg,
+			Version: &containeranalysispb.VulnerabilityType_Version{Name: installed},
+		},
+		FixedLocation: &containeranalysispb.VulnerabilityLocation{
+			Version: &containeranalysispb.VulnerabilityType_Version{Name: fixed, Kind: fixedKind},
+		},
+	}
+}
+
+func vulnOccurrence(name, note string, severity containeranalysispb.VulnerabilityType_Severity, issues ...*containeranalysispb.VulnerabilityType_PackageIssue) *containeranalysispb.Occurrence {
+	return &containeranalysispb.Occurrence{
+		Name:     name,
+		NoteName: note,
+		Details: &containeranalysispb.Occurrence_VulnerabilityDetails{
+			VulnerabilityDetails: &containeranalysispb.VulnerabilityType{
+				Severity:     severity,
+				PackageIssue: issues,
+			},
+		},
+	}
+}
+
+func TestGetVulnerabilitiesFromOccurenceMissingPackageIssue(t *testing.T) {
+	occ := vulnOccurrence("occurrences/1", "notes/CVE-1", containeranalysispb.VulnerabilityType_HIGH)
+	got := GetVulnerabilitiesFromOccurence(occ)
+	if len(got) != 1 {
+		t.Fatalf("got %d vulnerabilities, want 1", len(got))
+	}
+	want := metadata.Vulnerability{
+		OccurrenceName: "occurrences/1",
+		CVE:            "notes/CVE-1",
+		Severity:       metadata.SeverityHigh,
+	}
+	if got[0] != want {
+		t.Errorf("got %+v, want %+v", got[0], want)
+	}
+}
+
+func TestGetVulnerabilitiesFromOccurenceMixedFixAvailability(t *testing.T) {
+	occ := vulnOccurrence("occurrences/1", "notes/CVE-1", containeranalysispb.VulnerabilityType_CRITICAL,
+		packageIssue("openssl", "1.0.0", "", true),
+		packageIssue("curl", "7.0.0", "7.1.0", false),
+	)
+	got := GetVulnerabilitiesFromOccurence(occ)
+	if len(got) != 2 {
+		t.Fatalf("got %d vulnerabilities, want 2", len(got))
+	}
+	if got[0].Package != "openssl" || got[0].HasFixAvailable || got[0].FixedVersion != "" {
+		t.Errorf("openssl issue = %+v, want no fix available", got[0])
+	}
+	if got[1].Package != "curl" || !got[1].HasFixAvailable || got[1].FixedVersion != "7.1.0" {
+		t.Errorf("curl issue = %+v, want fix available at 7.1.0", got[1])
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// cosignSignaturePrefix marks a PgpSignedAttestation.Signature payload as
+// holding cosign occurrence data rather than an actual PGP signature. It is
+// the positive discriminator DecodeCosignOccurrenceDetails checks for,
+// rather than inferring the format from whether JSON-decoding the field
+// happens to succeed.
+const cosignSignaturePrefix = "kritis-cosign-v1:"
+
+// cosignOccurrenceData is what EncodeCosignOccurrenceDetails stores on an
+// Occurrence for a cosign-format attestation.
+type cosignOccurrenceData struct {
+	Envelope    string `json:"envelope"`
+	RekorLogURL string `json:"rekorLogUrl,omitempty"`
+}
+
+// EncodeCosignOccurrenceDetails packs a cosign DSSE envelope into the
+// containeranalysis v1alpha1 Occurrence_Attestation oneof, whose Details
+// message predates cosign and only defines a PgpSignedAttestation variant.
+// The envelope (and Rekor log URL, if any) are JSON-encoded, prefixed with
+// cosignSignaturePrefix, and stored in the Signature field; keyId goes into
+// KeyId. DecodeCosignOccurrenceDetails reverses this.
+func EncodeCosignOccurrenceDetails(envelope, keyId, rekorLogURL string) (*containeranalysispb.Occurrence_Attestation, error) {
+	data, err := json.Marshal(cosignOccurrenceData{Envelope: envelope, RekorLogURL: rekorLogURL})
+	if err != nil {
+		return nil, err
+	}
+	return &containeranalysispb.Occurrence_Attestation{
+		Attestation: &containeranalysispb.AttestationAuthority_Attestation{
+			Signature: &containeranalysispb.AttestationAuthority_Attestation_PgpSignedAttestation{
+				PgpSignedAttestation: &containeranalysispb.PgpSignedAttestation{
+					Signature: cosignSignaturePrefix + string(data),
+					KeyId: &containeranalysispb.PgpSignedAttestation_PgpKeyId{
+						PgpKeyId: keyId,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// DecodeCosignOccurrenceDetails reverses EncodeCosignOccurrenceDetails. It
+// returns an error, rather than panicking, when occ carries no Attestation
+// details or its Signature lacks the cosign discriminator prefix, so callers
+// can use the error to tell a cosign occurrence apart from a PGP one.
+func DecodeCosignOccurrenceDetails(occ *containeranalysispb.Occurrence) (CosignAttestation, error) {
+	attestation, ok := occ.GetDetails().(*containeranalysispb.Occurrence_Attestation)
+	if !ok {
+		return CosignAttestation{}, fmt.Errorf("occurrence %s has no attestation details", occ.GetName())
+	}
+	pgp := attestation.Attestation.GetPgpSignedAttestation()
+	signature := pgp.GetSignature()
+	if !strings.HasPrefix(signature, cosignSignaturePrefix) {
+		return CosignAttestation{}, fmt.Errorf("occurrence %s is not a cosign attestation", occ.GetName())
+	}
+	var data cosignOccurrenceData
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(signature, cosignSignaturePrefix)), &data); err != nil {
+		return CosignAttestation{}, err
+	}
+	return CosignAttestation{
+		Envelope:    data.Envelope,
+		KeyId:       pgp.GetPgpKeyId(),
+		RekorLogURL: data.RekorLogURL,
+	}, nil
+}
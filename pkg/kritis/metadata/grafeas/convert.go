@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grafeas
+
+import (
+	grafeaspb "github.com/grafeas/grafeas/proto/v1alpha1/grafeas_go_proto"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// toContaineranalysisNote converts a Grafeas Note into the equivalent
+// containeranalysis v1alpha1 Note, the schema Kritis's metadata.Fetcher
+// interface speaks regardless of which backend served the data.
+func toContaineranalysisNote(n *grafeaspb.Note) *containeranalysispb.Note {
+	return &containeranalysispb.Note{
+		Name:             n.GetName(),
+		ShortDescription: n.GetShortDescription(),
+		LongDescription:  n.GetLongDescription(),
+	}
+}
+
+// toContaineranalysisOccurrence converts a Grafeas AttestationAuthority
+// Occurrence into the equivalent containeranalysis v1alpha1 Occurrence.
+func toContaineranalysisOccurrence(o *grafeaspb.Occurrence) *containeranalysispb.Occurrence {
+	occ := &containeranalysispb.Occurrence{
+		Name:        o.GetName(),
+		ResourceUrl: o.GetResourceUrl(),
+		NoteName:    o.GetNoteName(),
+	}
+	pgp := o.GetAttestation().GetPgpSignedAttestation()
+	if pgp != nil {
+		occ.Details = &containeranalysispb.Occurrence_Attestation{
+			Attestation: &containeranalysispb.AttestationAuthority_Attestation{
+				Signature: &containeranalysispb.AttestationAuthority_Attestation_PgpSignedAttestation{
+					PgpSignedAttestation: &containeranalysispb.PgpSignedAttestation{
+						Signature: pgp.GetSignature(),
+						KeyId: &containeranalysispb.PgpSignedAttestation_PgpKeyId{
+							PgpKeyId: pgp.GetPgpKeyId(),
+						},
+					},
+				},
+			},
+		}
+	}
+	return occ
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grafeas implements metadata.Fetcher against a self-hosted Grafeas
+// server, so that Kritis can run outside of GKE/Container Analysis.
+package grafeas
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	grafeaspb "github.com/grafeas/grafeas/proto/v1alpha1/grafeas_go_proto"
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/constants"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+	"github.com/grafeas/kritis/pkg/kritis/util"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// Grafeas implements metadata.Fetcher against a self-hosted Grafeas server.
+// Like ContainerAnalysis, it does not require images to live in any
+// particular registry: the caller supplies the project Notes and
+// Occurrences are grouped under, and go-containerregistry parses image
+// references for any registry (GCR, ECR, GHCR, Docker Hub, Quay, ...).
+type Grafeas struct {
+	client  grafeaspb.GrafeasV1Alpha1Client
+	conn    *grpc.ClientConn
+	ctx     context.Context
+	project string
+}
+
+// NewGrafeasClient dials a self-hosted Grafeas server at address (e.g.
+// "grafeas.grafeas-system:8443") and returns a client that stores Notes and
+// Occurrences under project.
+func NewGrafeasClient(address, project string, dialOpts ...grpc.DialOption) (*Grafeas, error) {
+	conn, err := grpc.Dial(address, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("dialing grafeas server %s: %v", address, err)
+	}
+	return &Grafeas{
+		client:  grafeaspb.NewGrafeasV1Alpha1Client(conn),
+		conn:    conn,
+		ctx:     context.Background(),
+		project: project,
+	}, nil
+}
+
+// Close releases the underlying gRPC connection.
+func (g *Grafeas) Close() error {
+	return g.conn.Close()
+}
+
+var _ metadata.Fetcher = (*Grafeas)(nil)
+
+// GetVulnerabilities returns the PackageVulnerability occurrences for
+// containerImage that survive policy's filtering, logging each survivor.
+func (g *Grafeas) GetVulnerabilities(containerImage string, policy metadata.VulnerabilityPolicy) ([]metadata.Vulnerability, error) {
+	occs, err := g.fetchOccurrences(containerImage, "PACKAGE_VULNERABILITY")
+	if err != nil {
+		return nil, err
+	}
+	vulnz := []metadata.Vulnerability{}
+	for _, occ := range occs {
+		for _, v := range GetVulnerabilitiesFromOccurrence(occ) {
+			if !policy.Allows(v) {
+				continue
+			}
+			metadata.LogVulnerability(containerImage, v)
+			vulnz = append(vulnz, v)
+		}
+	}
+	return vulnz, nil
+}
+
+// GetVulnerabilitiesFromOccurrence flattens occ into one Vulnerability per
+// affected package, mirroring
+// containeranalysis.GetVulnerabilitiesFromOccurence so both backends agree
+// on occurrences with no PackageIssue entries: rather than assuming a fix is
+// available, they yield a single unfixable Vulnerability so it isn't
+// silently dropped.
+func GetVulnerabilitiesFromOccurrence(occ *grafeaspb.Occurrence) []metadata.Vulnerability {
+	vulnDetails := occ.GetVulnerabilityDetails()
+	severity := metadata.Severity(vulnDetails.GetSeverity().String())
+	issues := vulnDetails.GetPackageIssue()
+	if len(issues) == 0 {
+		return []metadata.Vulnerability{{
+			OccurrenceName: occ.GetName(),
+			CVE:            occ.GetNoteName(),
+			Severity:       severity,
+		}}
+	}
+	vulnz := make([]metadata.Vulnerability, len(issues))
+	for i, pi := range issues {
+		hasFixAvailable := pi.GetFixedLocation().GetVersion().GetKind() != grafeaspb.Version_MAXIMUM
+		var fixedVersion string
+		if hasFixAvailable {
+			fixedVersion = pi.GetFixedLocation().GetVersion().GetName()
+		}
+		vulnz[i] = metadata.Vulnerability{
+			OccurrenceName:   occ.GetName(),
+			CVE:              occ.GetNoteName(),
+			Severity:         severity,
+			HasFixAvailable:  hasFixAvailable,
+			Package:          pi.GetAffectedLocation().GetPackage(),
+			InstalledVersion: pi.GetAffectedLocation().GetVersion().GetName(),
+			FixedVersion:     fixedVersion,
+		}
+	}
+	return vulnz
+}
+
+// GetAttestations returns the AttestationAuthority occurrences for
+// containerImage, in whichever signature format they were created with.
+func (g *Grafeas) GetAttestations(containerImage string) ([]metadata.Attestation, error) {
+	occs, err := g.fetchOccurrences(containerImage, "ATTESTATION_AUTHORITY")
+	if err != nil {
+		return nil, err
+	}
+	attestations := make([]metadata.Attestation, len(occs))
+	for i, occ := range occs {
+		caOcc := toContaineranalysisOccurrence(occ)
+		if cosign, err := metadata.DecodeCosignOccurrenceDetails(caOcc); err == nil {
+			attestations[i] = metadata.Attestation{Format: kritisv1beta1.CosignSignatureFormat, Cosign: cosign}
+			continue
+		}
+		pgp := occ.GetAttestation().GetPgpSignedAttestation()
+		attestations[i] = metadata.Attestation{
+			Format: kritisv1beta1.PgpSignatureFormat,
+			Pgp: metadata.PgpAttestation{
+				Signature: pgp.GetSignature(),
+				KeyId:     pgp.GetPgpKeyId(),
+			},
+		}
+	}
+	return attestations, nil
+}
+
+func (g *Grafeas) fetchOccurrences(containerImage, kind string) ([]*grafeaspb.Occurrence, error) {
+	if _, err := name.ParseReference(containerImage, name.WeakValidation); err != nil {
+		return nil, fmt.Errorf("%s is not a valid image reference: %v", containerImage, err)
+	}
+	req := &grafeaspb.ListOccurrencesRequest{
+		Parent:   fmt.Sprintf("projects/%s", g.project),
+		Filter:   fmt.Sprintf("resource_url=%q AND kind=%q", getResourceUrl(containerImage), kind),
+		PageSize: constants.PageSize,
+	}
+	occs := []*grafeaspb.Occurrence{}
+	for {
+		resp, err := g.client.ListOccurrences(g.ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		occs = append(occs, resp.GetOccurrences()...)
+		if resp.GetNextPageToken() == "" {
+			return occs, nil
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+}
+
+func (g *Grafeas) CreateAttestationNote(aa kritisv1beta1.AttestationAuthority) error {
+	note := &grafeaspb.Note{
+		ShortDescription: "Image Policy Security Attestor",
+		LongDescription:  fmt.Sprintf("Image Policy Security Attestor deployed in %s namespace", aa.Namespace),
+		NoteType: &grafeaspb.Note_AttestationAuthority{
+			AttestationAuthority: &grafeaspb.AttestationAuthority{
+				Hint: &grafeaspb.AttestationAuthority_AttestationAuthorityHint{
+					HumanReadableName: aa.Name,
+				},
+			},
+		},
+	}
+	_, err := g.client.CreateNote(g.ctx, &grafeaspb.CreateNoteRequest{
+		Parent: fmt.Sprintf("projects/%s", g.project),
+		NoteId: aa.Name,
+		Note:   note,
+	})
+	return err
+}
+
+func (g *Grafeas) GetAttestationNote(aa kritisv1beta1.AttestationAuthority) (*containeranalysispb.Note, error) {
+	note, err := g.client.GetNote(g.ctx, &grafeaspb.GetNoteRequest{
+		Name: fmt.Sprintf("projects/%s/notes/%s", g.project, aa.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toContaineranalysisNote(note), nil
+}
+
+// CreateAttestationOccurence creates a signed attestation Occurrence against
+// note for containerImage, dispatching on signingKey.Format to sign with
+// either a PGP or a cosign key.
+func (g *Grafeas) CreateAttestationOccurence(note *containeranalysispb.Note, containerImage string, signingKey metadata.SigningKey) (*containeranalysispb.Occurrence, error) {
+	if _, err := name.ParseReference(containerImage, name.WeakValidation); err != nil {
+		return nil, fmt.Errorf("%s is not a valid image reference: %v", containerImage, err)
+	}
+	var pgpSignedAttestation *grafeaspb.PgpSignedAttestation
+	switch signingKey.Format {
+	case kritisv1beta1.CosignSignatureFormat:
+		envelope, err := util.CreateCosignAttestationSignature(containerImage, signingKey.Cosign)
+		if err != nil {
+			return nil, err
+		}
+		details, err := metadata.EncodeCosignOccurrenceDetails(envelope, signingKey.Cosign.SecretName, signingKey.RekorLogURL)
+		if err != nil {
+			return nil, err
+		}
+		pgp := details.Attestation.GetPgpSignedAttestation()
+		pgpSignedAttestation = &grafeaspb.PgpSignedAttestation{
+			Signature: pgp.GetSignature(),
+			KeyId:     &grafeaspb.PgpSignedAttestation_PgpKeyId{PgpKeyId: pgp.GetPgpKeyId()},
+		}
+	case kritisv1beta1.PgpSignatureFormat, "":
+		sig, err := util.CreateAttestationSignature(containerImage, signingKey.Pgp)
+		if err != nil {
+			return nil, err
+		}
+		pgpSignedAttestation = &grafeaspb.PgpSignedAttestation{
+			Signature: sig,
+			KeyId:     &grafeaspb.PgpSignedAttestation_PgpKeyId{PgpKeyId: signingKey.Pgp.SecretName},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signature format %q", signingKey.Format)
+	}
+
+	occ := &grafeaspb.Occurrence{
+		ResourceUrl: getResourceUrl(containerImage),
+		NoteName:    note.GetName(),
+		Details: &grafeaspb.Occurrence_Attestation{
+			Attestation: &grafeaspb.AttestationAuthority_Attestation{
+				Signature: &grafeaspb.AttestationAuthority_Attestation_PgpSignedAttestation{
+					PgpSignedAttestation: pgpSignedAttestation,
+				},
+			},
+		},
+	}
+	created, err := g.client.CreateOccurrence(g.ctx, &grafeaspb.CreateOccurrenceRequest{
+		Parent:     fmt.Sprintf("projects/%s", g.project),
+		Occurrence: occ,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toContaineranalysisOccurrence(created), nil
+}
+
+func (g *Grafeas) DeleteAttestationNote(aa kritisv1beta1.AttestationAuthority) error {
+	_, err := g.client.DeleteNote(g.ctx, &grafeaspb.DeleteNoteRequest{
+		Name: fmt.Sprintf("projects/%s/notes/%s", g.project, aa.Name),
+	})
+	return err
+}
+
+func (g *Grafeas) DeleteOccurrence(occurrenceId string) error {
+	_, err := g.client.DeleteOccurrence(g.ctx, &grafeaspb.DeleteOccurrenceRequest{
+		Name: occurrenceId,
+	})
+	return err
+}
+
+// getResourceUrl builds the resource_url Grafeas groups Occurrences by.
+// Occurrences are listed and created under the client's project, as in the
+// Container Analysis backend; no project is derived from the image.
+func getResourceUrl(containerImage string) string {
+	return fmt.Sprintf("%s%s", constants.ResourceUrlPrefix, containerImage)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grafeas
+
+import (
+	"testing"
+
+	grafeaspb "github.com/grafeas/grafeas/proto/v1alpha1/grafeas_go_proto"
+	"github.com/grafeas/kritis/pkg/kritis/metadata"
+)
+
+func packageIssue(pkg, installed, fixed string, noFix bool) *grafeaspb.VulnerabilityType_PackageIssue {
+	fixedKind := grafeaspb.Version_NORMAL
+	if noFix {
+		fixedKind = grafeaspb.Version_MAXIMUM
+	}
+	return &grafeaspb.VulnerabilityType_PackageIssue{
+		AffectedLocation: &grafeaspb.VulnerabilityLocation{
+			Package: pkg,
+			Version: &grafeaspb.Version{Name: installed},
+		},
+		FixedLocation: &grafeaspb.VulnerabilityLocation{
+			Version: &grafeaspb.Version{Name: fixed, Kind: fixedKind},
+		},
+	}
+}
+
+func vulnOccurrence(name, note string, severity grafeaspb.VulnerabilityType_Severity, issues ...*grafeaspb.VulnerabilityType_PackageIssue) *grafeaspb.Occurrence {
+	return &grafeaspb.Occurrence{
+		Name:     name,
+		NoteName: note,
+		Details: &grafeaspb.Occurrence_VulnerabilityDetails{
+			VulnerabilityDetails: &grafeaspb.VulnerabilityType{
+				Severity:     severity,
+				PackageIssue: issues,
+			},
+		},
+	}
+}
+
+// TestGetVulnerabilitiesFromOccurrenceMissingPackageIssue guards against the
+// Grafeas and Container Analysis backends diverging on occurrences with no
+// PackageIssue entries: both must report the occurrence as unfixable rather
+// than assuming a fix is available.
+func TestGetVulnerabilitiesFromOccurrenceMissingPackageIssue(t *testing.T) {
+	occ := vulnOccurrence("occurrences/1", "notes/CVE-1", grafeaspb.VulnerabilityType_HIGH)
+	got := GetVulnerabilitiesFromOccurrence(occ)
+	if len(got) != 1 {
+		t.Fatalf("got %d vulnerabilities, want 1", len(got))
+	}
+	want := metadata.Vulnerability{
+		OccurrenceName: "occurrences/1",
+		CVE:            "notes/CVE-1",
+		Severity:       metadata.SeverityHigh,
+	}
+	if got[0] != want {
+		t.Errorf("got %+v, want %+v", got[0], want)
+	}
+}
+
+func TestGetVulnerabilitiesFromOccurrenceMixedFixAvailability(t *testing.T) {
+	occ := vulnOccurrence("occurrences/1", "notes/CVE-1", grafeaspb.VulnerabilityType_CRITICAL,
+		packageIssue("openssl", "1.0.0", "", true),
+		packageIssue("curl", "7.0.0", "7.1.0", false),
+	)
+	got := GetVulnerabilitiesFromOccurrence(occ)
+	if len(got) != 2 {
+		t.Fatalf("got %d vulnerabilities, want 2", len(got))
+	}
+	if got[0].Package != "openssl" || got[0].HasFixAvailable || got[0].FixedVersion != "" {
+		t.Errorf("openssl issue = %+v, want no fix available", got[0])
+	}
+	if got[1].Package != "curl" || !got[1].HasFixAvailable || got[1].FixedVersion != "7.1.0" {
+		t.Errorf("curl issue = %+v, want fix available at 7.1.0", got[1])
+	}
+}
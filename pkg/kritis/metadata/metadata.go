@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metadata defines the Fetcher interface through which the
+// rest of Kritis reads vulnerability and attestation information, so that
+// callers don't need to know whether the data came from Google Container
+// Analysis, a self-hosted Grafeas server, or some other backend.
+package metadata
+
+import (
+	kritisv1beta1 "github.com/grafeas/kritis/pkg/kritis/apis/kritis/v1beta1"
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+	containeranalysispb "google.golang.org/genproto/googleapis/devtools/containeranalysis/v1alpha1"
+)
+
+// Fetcher is the interface every metadata backend implements. It is
+// deliberately expressed in terms of the containeranalysis v1alpha1 proto
+// types, which the Grafeas API was originally generated from, so that a
+// backend swap never requires translating callers as well.
+type Fetcher interface {
+	// GetVulnerabilities returns the PackageVulnerability occurrences for
+	// containerImage that survive policy's filtering.
+	GetVulnerabilities(containerImage string, policy VulnerabilityPolicy) ([]Vulnerability, error)
+	// GetAttestations returns the AttestationAuthority occurrences for
+	// containerImage, in whichever signature format they were created with.
+	GetAttestations(containerImage string) ([]Attestation, error)
+	// CreateAttestationNote creates the Note backing aa. The backend's
+	// error is returned as is, including when the Note already exists.
+	CreateAttestationNote(aa kritisv1beta1.AttestationAuthority) error
+	// GetAttestationNote fetches the Note backing aa.
+	GetAttestationNote(aa kritisv1beta1.AttestationAuthority) (*containeranalysispb.Note, error)
+	// CreateAttestationOccurence creates a signed attestation Occurrence
+	// against note for containerImage, using whichever key signingKey
+	// carries.
+	CreateAttestationOccurence(note *containeranalysispb.Note, containerImage string, signingKey SigningKey) (*containeranalysispb.Occurrence, error)
+	// DeleteAttestationNote deletes the Note backing aa. Used by tests.
+	DeleteAttestationNote(aa kritisv1beta1.AttestationAuthority) error
+	// DeleteOccurrence deletes the Occurrence named occurrenceId. Used by
+	// tests.
+	DeleteOccurrence(occurrenceId string) error
+}
+
+// Vulnerability contains the fields of a single package issue within a
+// PackageVulnerability occurrence that Kritis policies care about.
+type Vulnerability struct {
+	OccurrenceName   string
+	CVE              string
+	Severity         Severity
+	HasFixAvailable  bool
+	Package          string
+	InstalledVersion string
+	// FixedVersion is empty when HasFixAvailable is false.
+	FixedVersion string
+}
+
+// PgpAttestation contains the fields of an AttestationAuthority occurrence's
+// PgpSignedAttestation that Kritis policies care about.
+type PgpAttestation struct {
+	Signature string
+	KeyId     string
+}
+
+// CosignAttestation contains the fields of an AttestationAuthority
+// occurrence's cosign-style DSSE envelope that Kritis policies care about.
+type CosignAttestation struct {
+	// Envelope is the JSON-encoded DSSE envelope produced by
+	// util.CreateCosignAttestationSignature.
+	Envelope string
+	// KeyId identifies the cosign public key or KMS key that signed
+	// Envelope.
+	KeyId string
+	// RekorLogURL, if non-empty, is the base URL of the Rekor transparency
+	// log recorded on this attestation's occurrence.
+	RekorLogURL string
+}
+
+// Attestation is an AttestationAuthority occurrence, signed with either a
+// PGP or cosign key. Exactly one of Pgp or Cosign is set, matching Format.
+type Attestation struct {
+	Format kritisv1beta1.SignatureFormat
+	Pgp    PgpAttestation
+	Cosign CosignAttestation
+}
+
+// SigningKey carries the key material CreateAttestationOccurence signs
+// with. Exactly one of Pgp or Cosign should be set, matching Format.
+type SigningKey struct {
+	Format kritisv1beta1.SignatureFormat
+	Pgp    *secrets.PgpSigningSecret
+	Cosign *secrets.CosignSigningSecret
+	// RekorLogURL, for Format == CosignSignatureFormat, is recorded on the
+	// created occurrence (see Attestation.Cosign.RekorLogURL).
+	RekorLogURL string
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"github.com/golang/glog"
+)
+
+// Severity is a normalized vulnerability severity. Values are ordered from
+// least to most severe so VulnerabilityPolicy.MinSeverity can threshold on
+// them; severities outside this list rank below SeverityLow.
+type Severity string
+
+const (
+	SeverityLow      Severity = "LOW"
+	SeverityMedium   Severity = "MEDIUM"
+	SeverityHigh     Severity = "HIGH"
+	SeverityCritical Severity = "CRITICAL"
+)
+
+var severityRank = map[Severity]int{
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// VulnerabilityPolicy filters the vulnerabilities GetVulnerabilities
+// returns, so fetchers don't ship irrelevant findings to the admission
+// webhook.
+type VulnerabilityPolicy struct {
+	// MinSeverity is the lowest severity to report. Empty means no
+	// threshold.
+	MinSeverity Severity
+	// OnlyFixable, when true, drops vulnerabilities with no fix available.
+	OnlyFixable bool
+	// AllowlistCVEs are never reported, even if they would otherwise pass
+	// MinSeverity/OnlyFixable. Checked before BlocklistCVEs.
+	AllowlistCVEs []string
+	// BlocklistCVEs are always reported, regardless of MinSeverity or
+	// OnlyFixable.
+	BlocklistCVEs []string
+}
+
+// Allows reports whether v survives policy's filtering.
+func (p VulnerabilityPolicy) Allows(v Vulnerability) bool {
+	for _, cve := range p.AllowlistCVEs {
+		if cve == v.CVE {
+			return false
+		}
+	}
+	for _, cve := range p.BlocklistCVEs {
+		if cve == v.CVE {
+			return true
+		}
+	}
+	if p.OnlyFixable && !v.HasFixAvailable {
+		return false
+	}
+	if p.MinSeverity != "" && severityRank[v.Severity] < severityRank[p.MinSeverity] {
+		return false
+	}
+	return true
+}
+
+// LogVulnerability emits one structured log line for a vulnerability that
+// survived VulnerabilityPolicy filtering, so triage from cluster logs can
+// see exactly what's being enforced against.
+func LogVulnerability(containerImage string, v Vulnerability) {
+	fixedVersion := v.FixedVersion
+	if fixedVersion == "" {
+		fixedVersion = "no fix available"
+	}
+	glog.Infof("vulnerability found: occurrence=%q image=%q cve=%q severity=%s package=%q installed_version=%q fixed_version=%q (findings reflect package binaries present in image layers, not the layers themselves)",
+		v.OccurrenceName, containerImage, v.CVE, v.Severity, v.Package, v.InstalledVersion, fixedVersion)
+}
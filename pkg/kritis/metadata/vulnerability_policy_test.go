@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import "testing"
+
+func TestVulnerabilityPolicyAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy VulnerabilityPolicy
+		vuln   Vulnerability
+		want   bool
+	}{
+		{
+			name:   "no policy allows everything",
+			policy: VulnerabilityPolicy{},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityLow},
+			want:   true,
+		},
+		{
+			name:   "severity at threshold is allowed",
+			policy: VulnerabilityPolicy{MinSeverity: SeverityHigh},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityHigh},
+			want:   true,
+		},
+		{
+			name:   "severity above threshold is allowed",
+			policy: VulnerabilityPolicy{MinSeverity: SeverityHigh},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityCritical},
+			want:   true,
+		},
+		{
+			name:   "severity below threshold is dropped",
+			policy: VulnerabilityPolicy{MinSeverity: SeverityHigh},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityMedium},
+			want:   false,
+		},
+		{
+			name:   "only-fixable drops unfixable",
+			policy: VulnerabilityPolicy{OnlyFixable: true},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityCritical, HasFixAvailable: false},
+			want:   false,
+		},
+		{
+			name:   "only-fixable keeps fixable",
+			policy: VulnerabilityPolicy{OnlyFixable: true},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityCritical, HasFixAvailable: true},
+			want:   true,
+		},
+		{
+			name:   "blocklist overrides severity threshold",
+			policy: VulnerabilityPolicy{MinSeverity: SeverityCritical, BlocklistCVEs: []string{"CVE-1"}},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityLow},
+			want:   true,
+		},
+		{
+			name:   "allowlist drops an otherwise reported vulnerability",
+			policy: VulnerabilityPolicy{AllowlistCVEs: []string{"CVE-1"}},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: SeverityCritical, HasFixAvailable: true},
+			want:   false,
+		},
+		{
+			name:   "unrecognized severity ranks below any threshold",
+			policy: VulnerabilityPolicy{MinSeverity: SeverityLow},
+			vuln:   Vulnerability{CVE: "CVE-1", Severity: Severity("UNSPECIFIED")},
+			want:   false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.Allows(test.vuln); got != test.want {
+				t.Errorf("Allows() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secrets defines the key material Kritis reads from Kubernetes
+// Secrets in order to sign attestations.
+package secrets
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PrivateKeyDataKey is the Secret data key Kritis reads the signing
+	// private key (PGP-armored, or PEM-encoded for cosign) from.
+	PrivateKeyDataKey = "private"
+	// PublicKeyDataKey is the Secret data key Kritis reads the matching
+	// public key from, e.g. to register with Binary Authorization.
+	PublicKeyDataKey = "public"
+)
+
+// PublicKeyFromSecret returns the public key material stored under
+// PublicKeyDataKey in secret, the Kubernetes Secret named by an
+// AttestationAuthority's PrivateKeySecretName.
+func PublicKeyFromSecret(secret *corev1.Secret) (string, error) {
+	data, ok := secret.Data[PublicKeyDataKey]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no %q data key", secret.Namespace, secret.Name, PublicKeyDataKey)
+	}
+	return string(data), nil
+}
+
+// PgpSigningSecret holds the PGP private key material used to sign
+// attestations, along with the key id that verifiers look up Kritis's
+// public key by.
+type PgpSigningSecret struct {
+	PrivateKey string
+	SecretName string
+}
+
+// CosignSigningSecret holds the key material used to produce cosign-style
+// attestation signatures. util.CreateCosignAttestationSignature signs with
+// PrivateKey only: when KMSKeyRef is set it returns an error, and no KMS
+// signing is performed.
+type CosignSigningSecret struct {
+	// PrivateKey is a PEM-encoded PKCS8 ECDSA or Ed25519 private key.
+	PrivateKey string
+	// KMSKeyRef is a go-cloud-style KMS key reference, e.g.
+	// "awskms:///arn:aws:kms:...". Signing with it is not supported.
+	KMSKeyRef string
+	// SecretName is the key id recorded on attestations signed with this
+	// secret, so verifiers know which public key to check them against.
+	SecretName string
+}
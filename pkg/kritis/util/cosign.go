@@ -0,0 +1,384 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+)
+
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// inTotoStatement is the minimal in-toto attestation predicate cosign signs:
+// a statement that containerImage's digest was approved by this authority.
+type inTotoStatement struct {
+	Type          string          `json:"_type"`
+	PredicateType string          `json:"predicateType"`
+	Subject       []inTotoSubject `json:"subject"`
+	Predicate     struct{}        `json:"predicate"`
+}
+
+// inTotoSubject identifies the artifact an in-toto statement is about, per
+// https://in-toto.io/Statement/v0.1: Name is the repository the image
+// belongs to, and Digest binds the statement to one immutable image, the
+// same way cosign's own attestations do.
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// imageSubject builds the inTotoSubject cosign attestations are signed and
+// verified against. containerImage must be a digest reference
+// (repo@sha256:...); Kritis always resolves images to their digest before
+// signing or verifying an attestation, so a tag reference here is a caller
+// bug rather than something to silently resolve.
+func imageSubject(containerImage string) (inTotoSubject, error) {
+	digest, err := name.NewDigest(containerImage, name.WeakValidation)
+	if err != nil {
+		return inTotoSubject{}, fmt.Errorf("%s is not a digest reference: %v", containerImage, err)
+	}
+	algo, hexDigest, found := strings.Cut(digest.DigestStr(), ":")
+	if !found {
+		return inTotoSubject{}, fmt.Errorf("%s has a malformed digest %q", containerImage, digest.DigestStr())
+	}
+	return inTotoSubject{
+		Name:   digest.Repository.Name(),
+		Digest: map[string]string{algo: hexDigest},
+	}, nil
+}
+
+// dsseEnvelope is a DSSE (Dead Simple Signing Envelope) as produced by
+// cosign: https://github.com/secure-systems-lab/dsse.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// CreateCosignAttestationSignature creates a DSSE envelope, containing an
+// in-toto statement over containerImage's digest, signed with cosignKey.
+// The envelope is returned JSON-encoded, matching the format cosign writes
+// to a Grafeas/Container Analysis GenericSignedAttestation occurrence.
+func CreateCosignAttestationSignature(containerImage string, cosignKey *secrets.CosignSigningSecret) (string, error) {
+	if cosignKey.KMSKeyRef != "" {
+		return "", fmt.Errorf("signing via KMS key ref %s is not implemented by this client; use a cosign KMS-aware signer", cosignKey.KMSKeyRef)
+	}
+	subject, err := imageSubject(containerImage)
+	if err != nil {
+		return "", err
+	}
+	statement := inTotoStatement{
+		Type:          "https://in-toto.io/Statement/v0.1",
+		PredicateType: "https://kritis.grafeas.io/attestation/v1",
+		Subject:       []inTotoSubject{subject},
+	}
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return "", err
+	}
+
+	signer, err := parseCosignPrivateKey(cosignKey.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	sig, err := signDSSE(signer, inTotoPayloadType, payload)
+	if err != nil {
+		return "", err
+	}
+
+	envelope := dsseEnvelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []dsseSignature{{
+			KeyID: cosignKey.SecretName,
+			Sig:   base64.StdEncoding.EncodeToString(sig),
+		}},
+	}
+	b, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// VerifyCosignAttestationSignature checks that envelope is a DSSE envelope
+// over containerImage's digest, carrying a signature that verifies against
+// publicKeyPEM. When rekorLogURL is non-empty, that Rekor transparency log
+// must also return an entry for the payload's hash (see checkRekorLogEntry).
+func VerifyCosignAttestationSignature(containerImage, envelope, publicKeyPEM, rekorLogURL string) error {
+	var env dsseEnvelope
+	if err := json.Unmarshal([]byte(envelope), &env); err != nil {
+		return fmt.Errorf("parsing cosign envelope: %v", err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return fmt.Errorf("decoding cosign envelope payload: %v", err)
+	}
+	var statement inTotoStatement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return fmt.Errorf("parsing in-toto statement: %v", err)
+	}
+	wantSubject, err := imageSubject(containerImage)
+	if err != nil {
+		return err
+	}
+	if len(statement.Subject) == 0 || !subjectsEqual(statement.Subject[0], wantSubject) {
+		return fmt.Errorf("cosign attestation subject %v does not match %s", statement.Subject, containerImage)
+	}
+
+	pub, err := parseCosignPublicKey(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+	pae := dssePAE(env.PayloadType, payload)
+	for _, sig := range env.Signatures {
+		raw, err := base64.StdEncoding.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if !verifyDSSE(pub, pae, raw) {
+			continue
+		}
+		if rekorLogURL == "" {
+			return nil
+		}
+		return checkRekorLogEntry(rekorLogURL, payload, raw)
+	}
+	return fmt.Errorf("no cosign signature over %s verifies with the provided public key", containerImage)
+}
+
+// CosignSignatureAlgorithm returns the Binary Authorization
+// AttestorPublicKey.PkixPublicKey.SignatureAlgorithm value matching
+// publicKeyPEM's key type, so callers don't have to assume every cosign key
+// is ECDSA P-256: ed25519.PublicKey maps to "ED25519",
+// *ecdsa.PublicKey on the P-256 curve maps to "ECDSA_P256_SHA256", and
+// ECDSA keys on any other curve are rejected.
+func CosignSignatureAlgorithm(publicKeyPEM string) (string, error) {
+	pub, err := parseCosignPublicKey(publicKeyPEM)
+	if err != nil {
+		return "", err
+	}
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		return "ED25519", nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported ECDSA curve %s, only P-256 is supported", key.Curve.Params().Name)
+		}
+		return "ECDSA_P256_SHA256", nil
+	default:
+		return "", fmt.Errorf("unsupported cosign public key type %T", pub)
+	}
+}
+
+// subjectsEqual reports whether a and b identify the same repository and
+// digest. inTotoSubject embeds a map, so it can't be compared with ==.
+func subjectsEqual(a, b inTotoSubject) bool {
+	if a.Name != b.Name || len(a.Digest) != len(b.Digest) {
+		return false
+	}
+	for algo, hexDigest := range a.Digest {
+		if b.Digest[algo] != hexDigest {
+			return false
+		}
+	}
+	return true
+}
+
+func parseCosignPublicKey(pemData string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in cosign public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cosign public key: %v", err)
+	}
+	return pub, nil
+}
+
+// verifyDSSE reports whether sig is a valid signature over pae under pub.
+func verifyDSSE(pub crypto.PublicKey, pae, sig []byte) bool {
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, pae, sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(pae)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	default:
+		return false
+	}
+}
+
+// rekorLogEntry is the subset of Rekor's LogEntryAnon response used to
+// confirm inclusion, per
+// https://github.com/sigstore/rekor/blob/main/pkg/generated/models/log_entry_anon.go.
+type rekorLogEntry struct {
+	Body         string `json:"body"`
+	Verification struct {
+		InclusionProof struct {
+			Hashes   []string `json:"hashes"`
+			LogIndex int64    `json:"logIndex"`
+			RootHash string   `json:"rootHash"`
+			TreeSize int64    `json:"treeSize"`
+		} `json:"inclusionProof"`
+	} `json:"verification"`
+}
+
+// checkRekorLogEntry confirms the Rekor transparency log rekorLogURL holds
+// an entry for the given DSSE payload, by searching the log for the
+// payload's SHA-256 hash and verifying the first returned entry's Merkle
+// inclusion proof reconstructs that entry's own reported root hash
+// (RFC 6962 §2.1.1). sig is not compared against the entry's body, so any
+// entry for the same payload is accepted. This proves the entry
+// Rekor returned is internally consistent; it does not verify that root
+// hash against a signed checkpoint from Rekor's own key, which would
+// additionally require pinning that key, so a Rekor server willing to lie
+// about its whole tree could still forge a match.
+func checkRekorLogEntry(rekorLogURL string, payload, sig []byte) error {
+	hash := sha256.Sum256(payload)
+	reqBody, err := json.Marshal(map[string]string{"hash": "sha256:" + hex.EncodeToString(hash[:])})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(strings.TrimRight(rekorLogURL, "/")+"/api/v1/log/entries/retrieve", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("querying Rekor log %s: %v", rekorLogURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("querying Rekor log %s: status %s", rekorLogURL, resp.Status)
+	}
+	var entriesByUUID map[string]rekorLogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entriesByUUID); err != nil {
+		return fmt.Errorf("decoding Rekor log %s response: %v", rekorLogURL, err)
+	}
+	for uuid, entry := range entriesByUUID {
+		if err := verifyRekorInclusionProof(entry); err != nil {
+			return fmt.Errorf("Rekor entry %s failed inclusion proof verification: %v", uuid, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no Rekor entry found in %s for this signature", rekorLogURL)
+}
+
+// verifyRekorInclusionProof recomputes the Merkle tree root over entry's
+// body from its inclusion proof and checks it matches the root hash the
+// proof itself claims, following RFC 6962 §2.1.1.
+func verifyRekorInclusionProof(entry rekorLogEntry) error {
+	proof := entry.Verification.InclusionProof
+	wantRoot, err := hex.DecodeString(proof.RootHash)
+	if err != nil {
+		return fmt.Errorf("decoding root hash: %v", err)
+	}
+	leaf := rekorLeafHash([]byte(entry.Body))
+	node, lastNode := proof.LogIndex, proof.TreeSize-1
+	hash := leaf
+	for _, h := range proof.Hashes {
+		sibling, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("decoding proof hash: %v", err)
+		}
+		switch {
+		case lastNode == 0:
+			return fmt.Errorf("inclusion proof has more hashes than the tree has levels")
+		case node%2 == 1 || node == lastNode:
+			hash = rekorNodeHash(sibling, hash)
+			for node%2 == 0 && node != 0 {
+				node >>= 1
+				lastNode >>= 1
+			}
+		default:
+			hash = rekorNodeHash(hash, sibling)
+		}
+		node >>= 1
+		lastNode >>= 1
+	}
+	if !bytes.Equal(hash, wantRoot) {
+		return fmt.Errorf("computed root %x does not match claimed root %x", hash, wantRoot)
+	}
+	return nil
+}
+
+func rekorLeafHash(leaf []byte) []byte {
+	h := sha256.Sum256(append([]byte{0x00}, leaf...))
+	return h[:]
+}
+
+func rekorNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func parseCosignPrivateKey(pemData string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in cosign signing key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cosign signing key: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("cosign signing key type %T does not implement crypto.Signer", key)
+	}
+	return signer, nil
+}
+
+// signDSSE signs payload using the DSSE pre-authentication encoding (PAE),
+// which binds the payload type into the signature.
+func signDSSE(signer crypto.Signer, payloadType string, payload []byte) ([]byte, error) {
+	pae := dssePAE(payloadType, payload)
+	switch signer.Public().(type) {
+	case ed25519.PublicKey:
+		return signer.Sign(rand.Reader, pae, crypto.Hash(0))
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(pae)
+		return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported cosign key type %T", signer.Public())
+	}
+}
+
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package util contains helpers for producing attestation signatures that
+// are shared across metadata backends.
+package util
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/grafeas/kritis/pkg/kritis/secrets"
+)
+
+// CreateAttestationSignature creates a detached, armored PGP signature over
+// containerImage using the given signing key.
+func CreateAttestationSignature(containerImage string, pgpSigningKey *secrets.PgpSigningSecret) (string, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(pgpSigningKey.PrivateKey))
+	if err != nil {
+		return "", err
+	}
+	var sig strings.Builder
+	if err := openpgp.ArmoredDetachSign(&sig, keyring[0], strings.NewReader(containerImage), nil); err != nil {
+		return "", err
+	}
+	return sig.String(), nil
+}
+
+// VerifyAttestationSignature checks that signature is a valid detached,
+// armored PGP signature over containerImage from a key in the armored
+// keyring publicKey.
+func VerifyAttestationSignature(containerImage, signature, publicKey string) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil {
+		return err
+	}
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, strings.NewReader(containerImage), strings.NewReader(signature))
+	return err
+}